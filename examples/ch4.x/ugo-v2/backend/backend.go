@@ -0,0 +1,122 @@
+// Package backend turns a *ir.Module into bytes on disk: textual LLVM
+// IR, a native object file, or a linked executable. It is the only
+// place that knows the project shells out to the system LLVM toolchain
+// (llc) and a linker (cc) to do so, the same way cmd/compile hides its
+// object-file writer behind a single entry point.
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/chai2010/ugo/builtin"
+	"github.com/chai2010/ugo/ir"
+)
+
+// Output selects what Emit produces.
+type Output int
+
+const (
+	// OutputLLVM writes textual LLVM IR, today's Compiler.CompileLL
+	// behavior.
+	OutputLLVM Output = iota
+	// OutputObject writes a native .o.
+	OutputObject
+	// OutputExecutable links a native .o against the uGo runtime to
+	// produce a runnable binary.
+	OutputExecutable
+)
+
+// BackendConfig controls how Emit lowers a Module.
+type BackendConfig struct {
+	Output Output
+	// OutputPath is where the result is written.
+	OutputPath string
+	// TargetTriple is passed to llc, e.g. "x86_64-unknown-linux-gnu".
+	// Empty means llc's host default.
+	TargetTriple string
+	// OptLevel is llc's -O level, 0 through 3.
+	OptLevel int
+	// DebugInfo asks llc to keep debug info in the output.
+	DebugInfo bool
+}
+
+// Emit lowers module according to cfg.Output, writing the result to
+// cfg.OutputPath.
+func Emit(module *ir.Module, cfg BackendConfig) error {
+	switch cfg.Output {
+	case OutputLLVM:
+		return emitLLVM(module, cfg)
+	case OutputObject:
+		return emitObject(module, cfg)
+	case OutputExecutable:
+		return emitExecutable(module, cfg)
+	default:
+		return fmt.Errorf("backend: unknown output kind %d", cfg.Output)
+	}
+}
+
+func emitLLVM(module *ir.Module, cfg BackendConfig) error {
+	var buf bytes.Buffer
+	ir.WriteLLVM(&buf, module)
+	return os.WriteFile(cfg.OutputPath, buf.Bytes(), 0644)
+}
+
+// emitObject writes module to a temp .ll file and invokes llc on it,
+// hiding that intermediate step from the caller.
+func emitObject(module *ir.Module, cfg BackendConfig) error {
+	llPath, cleanup, err := writeTempLL(module)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	args := []string{"-filetype=obj", fmt.Sprintf("-O%d", cfg.OptLevel)}
+	if cfg.TargetTriple != "" {
+		args = append(args, "-mtriple="+cfg.TargetTriple)
+	}
+	if cfg.DebugInfo {
+		args = append(args, "-dwarf-version=4")
+	}
+	args = append(args, "-o", cfg.OutputPath, llPath)
+
+	cmd := exec.Command("llc", args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("backend: llc: %w", err)
+	}
+	return nil
+}
+
+// emitExecutable produces an object file the same way emitObject does,
+// then links it with the uGo runtime to produce a runnable binary.
+func emitExecutable(module *ir.Module, cfg BackendConfig) error {
+	objPath := cfg.OutputPath + ".o"
+	objCfg := cfg
+	objCfg.Output = OutputObject
+	objCfg.OutputPath = objPath
+	if err := emitObject(module, objCfg); err != nil {
+		return err
+	}
+	defer os.Remove(objPath)
+
+	cmd := exec.Command("cc", objPath, builtin.Runtime, "-o", cfg.OutputPath)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("backend: link: %w", err)
+	}
+	return nil
+}
+
+func writeTempLL(module *ir.Module) (path string, cleanup func(), err error) {
+	f, err := os.CreateTemp("", "ugo-*.ll")
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	ir.WriteLLVM(f, module)
+	return f.Name(), func() { os.Remove(f.Name()) }, nil
+}
@@ -3,30 +3,47 @@ package compiler
 import (
 	"bytes"
 	"fmt"
-	"io"
 
 	"github.com/chai2010/ugo/ast"
 	"github.com/chai2010/ugo/builtin"
+	"github.com/chai2010/ugo/ir"
 	"github.com/chai2010/ugo/logger"
 	"github.com/chai2010/ugo/token"
+	"github.com/chai2010/ugo/typecheck"
+	"github.com/chai2010/ugo/types"
 )
 
 type Compiler struct {
-	file   *ast.File
-	scope  *Scope
-	nextId int
+	file    *ast.File
+	scope   *Scope
+	info    *typecheck.Info
+	module  *ir.Module
+	b       *ir.Builder
+	curFunc *ast.Func
 }
 
-func (p *Compiler) Compile(file *ast.File) string {
-	var buf bytes.Buffer
-
+// Compile builds file into an in-memory *ir.Module, ready to hand to
+// ir.WriteLLVM or to a backend.Emit for object/executable output.
+func (p *Compiler) Compile(file *ast.File) *ir.Module {
 	p.file = file
 	p.scope = NewScope(Universe)
+	p.info = typecheck.Check(file)
+	p.module = ir.NewModule(file.Pkg.Name)
+	p.b = ir.NewBuilder(p.module)
+
+	p.compileFile(file)
+
+	p.module.Header = p.genHeader(file)
+	p.module.Trailer = p.genMain(file)
 
-	p.genHeader(&buf, file)
-	p.compileFile(&buf, file)
-	p.genMain(&buf, file)
+	return p.module
+}
 
+// CompileLL is a convenience wrapper around Compile for callers that
+// just want today's textual LLVM IR.
+func (p *Compiler) CompileLL(file *ast.File) string {
+	var buf bytes.Buffer
+	ir.WriteLLVM(&buf, p.Compile(file))
 	return buf.String()
 }
 
@@ -38,63 +55,131 @@ func (p *Compiler) leaveScope() {
 	p.scope = p.scope.Outer
 }
 
-func (p *Compiler) genHeader(w io.Writer, file *ast.File) {
-	fmt.Fprintf(w, "; package %s\n", file.Pkg.Name)
-	fmt.Fprintln(w, builtin.Header)
+func (p *Compiler) genHeader(file *ast.File) string {
+	return fmt.Sprintf("; package %s\n%s", file.Pkg.Name, builtin.Header)
 }
 
-func (p *Compiler) genMain(w io.Writer, file *ast.File) {
+func (p *Compiler) genMain(file *ast.File) string {
 	if file.Pkg.Name != "main" {
-		return
+		return ""
 	}
 	for _, fn := range file.Funcs {
 		if fn.Name == "main" {
-			fmt.Fprintln(w, builtin.MainMain)
-			return
+			return builtin.MainMain
 		}
 	}
+	return ""
 }
 
-func (p *Compiler) compileFile(w io.Writer, file *ast.File) {
+func (p *Compiler) compileFile(file *ast.File) {
 	for _, g := range file.Globals {
 		var llName = fmt.Sprintf("@ugo_%s_%s", file.Pkg.Name, g.Name.Name)
+		t := p.typeOfObject(g)
 		p.scope.Insert(&Object{
 			Name:   g.Name.Name,
 			LLName: llName,
 			Node:   g,
+			Type:   t,
 		})
-		fmt.Fprintf(w, "%s = global i32 0\n", llName)
+		p.module.AddGlobal(&ir.Global{LLName: llName, Type: t.LLVM()})
 	}
-	if len(file.Globals) != 0 {
-		fmt.Fprintln(w)
+	// Registered up front so a function can call one defined later in
+	// the file, or itself.
+	for _, fn := range file.Funcs {
+		p.scope.Insert(&Object{
+			Name:   fn.Name,
+			LLName: fmt.Sprintf("@ugo_%s_%s", file.Pkg.Name, fn.Name),
+			Node:   fn,
+			Type:   p.typeOfObject(fn),
+		})
 	}
 	for _, fn := range file.Funcs {
-		p.compileFunc(w, file, fn)
+		p.compileFunc(file, fn)
 	}
 }
 
-func (p *Compiler) compileFunc(w io.Writer, file *ast.File, fn *ast.Func) {
+// typeOfObject looks up the type the typecheck pass assigned to node,
+// falling back to int32 for anything it didn't see (there is no
+// surface syntax for other types yet).
+func (p *Compiler) typeOfObject(node ast.Node) types.Type {
+	if t, ok := p.info.Objects[node]; ok && t != nil {
+		return t
+	}
+	return types.TypInt32
+}
+
+func (p *Compiler) typeOfExpr(expr ast.Expr) types.Type {
+	if t, ok := p.info.Types[expr]; ok && t != nil {
+		return t
+	}
+	return types.TypInt32
+}
+
+func (p *Compiler) compileFunc(file *ast.File, fn *ast.Func) {
+	llName := fmt.Sprintf("@ugo_%s_%s", file.Pkg.Name, fn.Name)
+	funcType, _ := p.typeOfObject(fn).(*types.Func)
+	resultLLVM := "void"
+	if funcType != nil {
+		resultLLVM = funcType.LLVM()
+	}
+
 	if fn.Body == nil {
-		fmt.Fprintf(w, "declare i32 @ugo_%s_%s() {\n", file.Pkg.Name, fn.Name)
+		var params []ir.Param
+		for i := range fn.Params {
+			params = append(params, ir.Param{Type: funcType.Params[i].LLVM()})
+		}
+		p.module.AddFunc(&ir.Function{LLName: llName, Params: params, ResultType: resultLLVM})
 		return
 	}
 
 	p.enterScope()
 	defer p.leaveScope()
 
-	fmt.Fprintf(w, "define i32 @ugo_%s_%s() {\n", file.Pkg.Name, fn.Name)
-	p.compileStmt(w, fn.Body)
+	p.curFunc = fn
+	defer func() { p.curFunc = nil }()
+
+	irFn := &ir.Function{LLName: llName, ResultType: resultLLVM}
+	p.module.AddFunc(irFn)
+
+	p.b.SetFunc(irFn)
+	p.b.NewBlock("entry")
+
+	for i, param := range fn.Params {
+		paramType := p.typeOfObject(param)
+		paramReg := fmt.Sprintf("%%param.%d", i)
+		irFn.Params = append(irFn.Params, ir.Param{LLName: paramReg, Type: paramType.LLVM()})
+
+		var llName = fmt.Sprintf("%%local_%s.param.%d", param.Name.Name, i)
+		p.scope.Insert(&Object{
+			Name:   param.Name.Name,
+			LLName: llName,
+			Node:   param,
+			Type:   paramType,
+		})
+
+		ptr := p.b.CreateAlloca(llName, paramType.LLVM())
+		p.b.CreateStore(ir.Value{Name: paramReg, Type: paramType.LLVM()}, ptr)
+	}
+
+	p.compileStmt(fn.Body)
 
-	fmt.Fprintln(w, "\tret i32 0")
-	fmt.Fprintln(w, "}")
+	if !p.b.BlockTerminated() {
+		if resultLLVM == "void" {
+			p.b.CreateRet(ir.Value{})
+		} else {
+			p.b.CreateRet(ir.Value{Name: "0", Type: resultLLVM})
+		}
+	}
 }
 
-func (p *Compiler) compileStmt(w io.Writer, stmt ast.Stmt) {
+func (p *Compiler) compileStmt(stmt ast.Stmt) {
 	switch stmt := stmt.(type) {
 	case *ast.VarSpec:
-		var localName = "0"
+		t := p.typeOfObject(stmt)
+		var val = ir.Value{Name: "0", Type: t.LLVM()}
 		if stmt.Value != nil {
-			localName = p.compileExpr(w, stmt.Value)
+			v, vt := p.compileExpr(stmt.Value)
+			val = p.convert(v, vt, t)
 		}
 
 		var llName = fmt.Sprintf("%%local_%s.pos.%d", stmt.Name.Name, stmt.VarPos)
@@ -102,110 +187,310 @@ func (p *Compiler) compileStmt(w io.Writer, stmt ast.Stmt) {
 			Name:   stmt.Name.Name,
 			LLName: llName,
 			Node:   stmt,
+			Type:   t,
 		})
 
-		fmt.Fprintf(w, "\t%s = alloca i32, align 4\n", llName)
-		fmt.Fprintf(
-			w, "\tstore i32 %s, i32* %s\n",
-			localName, llName,
-		)
+		ptr := p.b.CreateAlloca(llName, t.LLVM())
+		p.b.CreateStore(val, ptr)
 
 	case *ast.AssignStmt:
-		var varName string
-		if obj := p.scope.Lookup(stmt.Target.Name); obj != nil {
-			varName = obj.LLName
-		} else if _, obj := p.scope.LookupParent(stmt.Target.Name); obj != nil {
-			varName = obj.LLName
+		var obj *Object
+		if o := p.scope.Lookup(stmt.Target.Name); o != nil {
+			obj = o
+		} else if _, o := p.scope.LookupParent(stmt.Target.Name); o != nil {
+			obj = o
 		} else {
 			logger.Panicf("var %s undefined", stmt.Target.Name)
 		}
 
-		localName := p.compileExpr(w, stmt.Value)
-		fmt.Fprintf(
-			w, "\tstore i32 %s, i32* %s\n",
-			localName, varName,
-		)
+		v, vt := p.compileExpr(stmt.Value)
+		val := p.convert(v, vt, obj.Type)
+		p.b.CreateStore(val, ir.Value{Name: obj.LLName, Type: obj.Type.LLVM() + "*"})
 
 	case *ast.BlockStmt:
 		p.enterScope()
 		defer p.leaveScope()
 
 		for _, x := range stmt.List {
-			p.compileStmt(w, x)
+			if p.b.BlockTerminated() {
+				break
+			}
+			p.compileStmt(x)
 		}
 	case *ast.ExprStmt:
-		p.compileExpr(w, stmt.X)
+		p.compileExpr(stmt.X)
+
+	case *ast.IfStmt:
+		p.compileIfStmt(stmt)
+
+	case *ast.ForStmt:
+		p.compileForStmt(stmt)
+
+	case *ast.ReturnStmt:
+		if len(stmt.Results) == 0 {
+			p.b.CreateRet(ir.Value{})
+		} else {
+			val, t := p.compileExpr(stmt.Results[0])
+			resultType, _ := p.typeOfObject(p.curFunc).(*types.Func)
+			if resultType != nil && len(resultType.Results) > 0 {
+				val = p.convert(val, t, resultType.Results[0])
+			}
+			p.b.CreateRet(val)
+		}
 
 	default:
 		logger.Panicf("unknown: %[1]T, %[1]v", stmt)
 	}
 }
 
-func (p *Compiler) compileExpr(w io.Writer, expr ast.Expr) (localName string) {
+// compileIfStmt lowers `if cond { then } else { els }` to a cond-br
+// between a then-block and an else-block (or straight to the end-block
+// when there is no else) that both rejoin at an end-block. Variables
+// assigned inside either branch are visible afterwards because they
+// were already given an alloca slot by *ast.VarSpec; nothing needs a
+// phi node here, only the &&/|| condition values do (see
+// compileShortCircuit).
+//
+// Either branch may already have terminated its block itself (a
+// return inside the body), in which case branching to endLabel on top
+// of that would give the block two terminators; only bridge to
+// endLabel when the branch fell through without one.
+func (p *Compiler) compileIfStmt(stmt *ast.IfStmt) {
+	thenLabel := p.b.NewLabel("if.then")
+	endLabel := p.b.NewLabel("if.end")
+	elseLabel := endLabel
+	if stmt.Else != nil {
+		elseLabel = p.b.NewLabel("if.else")
+	}
+
+	cond := p.compileCond(stmt.Cond)
+	p.b.CreateCondBr(cond, thenLabel, elseLabel)
+
+	p.b.NewBlock(thenLabel)
+	p.compileStmt(stmt.Body)
+	if !p.b.BlockTerminated() {
+		p.b.CreateBr(endLabel)
+	}
+
+	if stmt.Else != nil {
+		p.b.NewBlock(elseLabel)
+		p.compileStmt(stmt.Else)
+		if !p.b.BlockTerminated() {
+			p.b.CreateBr(endLabel)
+		}
+	}
+
+	p.b.NewBlock(endLabel)
+}
+
+// compileForStmt lowers a C-style `for init; cond; post { body }` to a
+// cond-block/body-block/post-block/end-block chain, branching back
+// from post to cond.
+func (p *Compiler) compileForStmt(stmt *ast.ForStmt) {
+	p.enterScope()
+	defer p.leaveScope()
+
+	if stmt.Init != nil {
+		p.compileStmt(stmt.Init)
+	}
+
+	condLabel := p.b.NewLabel("for.cond")
+	bodyLabel := p.b.NewLabel("for.body")
+	postLabel := p.b.NewLabel("for.post")
+	endLabel := p.b.NewLabel("for.end")
+
+	p.b.CreateBr(condLabel)
+	p.b.NewBlock(condLabel)
+	if stmt.Cond != nil {
+		cond := p.compileCond(stmt.Cond)
+		p.b.CreateCondBr(cond, bodyLabel, endLabel)
+	} else {
+		p.b.CreateBr(bodyLabel)
+	}
+
+	p.b.NewBlock(bodyLabel)
+	p.compileStmt(stmt.Body)
+	if !p.b.BlockTerminated() {
+		p.b.CreateBr(postLabel)
+	}
+
+	p.b.NewBlock(postLabel)
+	if stmt.Post != nil {
+		p.compileStmt(stmt.Post)
+	}
+	if !p.b.BlockTerminated() {
+		p.b.CreateBr(condLabel)
+	}
+
+	p.b.NewBlock(endLabel)
+}
+
+// compileCond evaluates expr as a branch condition, producing an i1
+// value. &&/|| route through basic-block branching instead of i32
+// arithmetic so that the right-hand side is only evaluated when it can
+// affect the result; anything that already typechecked as bool (e.g. a
+// comparison) is used as-is instead of being compared against zero.
+func (p *Compiler) compileCond(expr ast.Expr) ir.Value {
+	val, t := p.compileExpr(expr)
+	if b, ok := t.(*types.Basic); ok && b.Kind() == types.Bool {
+		return val
+	}
+	return p.b.CreateICmpNE(val, ir.Value{Name: "0", Type: val.Type})
+}
+
+// compileShortCircuit lowers `x && y` (isAnd) / `x || y` to a branch
+// that only evaluates y when it is needed, merging the two possible
+// results with a phi node.
+func (p *Compiler) compileShortCircuit(expr *ast.BinaryExpr, isAnd bool) ir.Value {
+	rhsLabel := p.b.NewLabel("shortcirc.rhs")
+	endLabel := p.b.NewLabel("shortcirc.end")
+
+	lhs := p.compileCond(expr.X)
+	lhsLabel := p.b.CurrentBlockLabel()
+	if isAnd {
+		p.b.CreateCondBr(lhs, rhsLabel, endLabel)
+	} else {
+		p.b.CreateCondBr(lhs, endLabel, rhsLabel)
+	}
+
+	p.b.NewBlock(rhsLabel)
+	rhs := p.compileCond(expr.Y)
+	rhsLabel = p.b.CurrentBlockLabel()
+	if !p.b.BlockTerminated() {
+		p.b.CreateBr(endLabel)
+	}
+
+	p.b.NewBlock(endLabel)
+	return p.b.CreatePHI("i1", []ir.PHIIncoming{
+		{Value: lhs, Label: lhsLabel},
+		{Value: rhs, Label: rhsLabel},
+	})
+}
+
+// compileExpr compiles expr and returns both the LLVM value it
+// produced and the language-level type the typecheck pass assigned to
+// it, so callers can pick the right instruction (add vs fadd, sdiv vs
+// udiv, icmp vs fcmp, ...) and insert conversions where needed.
+func (p *Compiler) compileExpr(expr ast.Expr) (val ir.Value, t types.Type) {
+	t = p.typeOfExpr(expr)
+
 	switch expr := expr.(type) {
 	case *ast.Ident:
-		var varName string
-		if obj := p.scope.Lookup(expr.Name); obj != nil {
-			varName = obj.LLName
-		} else if _, obj := p.scope.LookupParent(expr.Name); obj != nil {
-			varName = obj.LLName
+		var obj *Object
+		if o := p.scope.Lookup(expr.Name); o != nil {
+			obj = o
+		} else if _, o := p.scope.LookupParent(expr.Name); o != nil {
+			obj = o
 		} else {
 			logger.Panicf("var %s undefined", expr.Name)
 		}
 
-		localName = p.genId()
-		fmt.Fprintf(w, "\t%s = load i32, i32* %s, align 4\n",
-			localName, varName,
-		)
-		return localName
+		val = p.b.CreateLoad(ir.Value{Name: obj.LLName, Type: obj.Type.LLVM() + "*"})
+		return val, obj.Type
+
 	case *ast.Number:
-		localName = p.genId()
-		fmt.Fprintf(w, "\t%s = %s i32 %v, %v\n",
-			localName, "add", `0`, expr.Value,
-		)
-		return localName
+		zero := ir.Value{Name: "0", Type: t.LLVM()}
+		lit := ir.Value{Name: fmt.Sprintf("%v", expr.Value), Type: t.LLVM()}
+		if isFloat(t) {
+			val = p.b.CreateFAdd(zero, lit)
+		} else {
+			val = p.b.CreateAdd(zero, lit)
+		}
+		return val, t
+
 	case *ast.BinaryExpr:
-		localName = p.genId()
+		if expr.Op == token.LAND {
+			return p.compileShortCircuit(expr, true), types.TypBool
+		}
+		if expr.Op == token.LOR {
+			return p.compileShortCircuit(expr, false), types.TypBool
+		}
+
+		x, xt := p.compileExpr(expr.X)
+		y, yt := p.compileExpr(expr.Y)
+		y = p.convert(y, yt, xt)
+
 		switch expr.Op {
 		case token.ADD:
-			fmt.Fprintf(w, "\t%s = %s i32 %v, %v\n",
-				localName, "add", p.compileExpr(w, expr.X), p.compileExpr(w, expr.Y),
-			)
-			return localName
+			if isFloat(xt) {
+				return p.b.CreateFAdd(x, y), xt
+			}
+			return p.b.CreateAdd(x, y), xt
 		case token.SUB:
-			fmt.Fprintf(w, "\t%s = %s i32 %v, %v\n",
-				localName, "sub", p.compileExpr(w, expr.X), p.compileExpr(w, expr.Y),
-			)
-			return localName
+			if isFloat(xt) {
+				return p.b.CreateFSub(x, y), xt
+			}
+			return p.b.CreateSub(x, y), xt
 		case token.MUL:
-			fmt.Fprintf(w, "\t%s = %s i32 %v, %v\n",
-				localName, "mul", p.compileExpr(w, expr.X), p.compileExpr(w, expr.Y),
-			)
-			return localName
+			if isFloat(xt) {
+				return p.b.CreateFMul(x, y), xt
+			}
+			return p.b.CreateMul(x, y), xt
 		case token.DIV:
-			fmt.Fprintf(w, "\t%s = %s i32 %v, %v\n",
-				localName, "div", p.compileExpr(w, expr.X), p.compileExpr(w, expr.Y),
-			)
-			return localName
+			switch {
+			case isFloat(xt):
+				return p.b.CreateFDiv(x, y), xt
+			case isUnsigned(xt):
+				return p.b.CreateUDiv(x, y), xt
+			default:
+				return p.b.CreateSDiv(x, y), xt
+			}
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			if isFloat(xt) {
+				return p.b.CreateFCmp(fcmpPred(expr.Op), x, y), types.TypBool
+			}
+			return p.b.CreateICmp(icmpPred(expr.Op, isUnsigned(xt)), x, y), types.TypBool
 		}
+
 	case *ast.UnaryExpr:
+		x, xt := p.compileExpr(expr.X)
 		if expr.Op == token.SUB {
-			localName = p.genId()
-			fmt.Fprintf(w, "\t%s = %s i32 %v, %v\n",
-				localName, "sub", `0`, p.compileExpr(w, expr.X),
-			)
-			return localName
+			zero := ir.Value{Name: "0", Type: xt.LLVM()}
+			if isFloat(xt) {
+				return p.b.CreateFSub(zero, x), xt
+			}
+			return p.b.CreateSub(zero, x), xt
 		}
-		return p.compileExpr(w, expr.X)
+		return x, xt
+
 	case *ast.ParenExpr:
-		return p.compileExpr(w, expr.X)
+		return p.compileExpr(expr.X)
+
 	case *ast.CallExpr:
-		// call i32(i32) @ugo_builtin_exit(i32 %t2)
-		localName = p.genId()
-		fmt.Fprintf(w, "\t%s = call i32(i32) @ugo_builtin_%s(i32 %v)\n",
-			localName, expr.FuncName.Name, p.compileExpr(w, expr.Args[0]),
-		)
-		return localName
+		var obj *Object
+		if o := p.scope.Lookup(expr.FuncName.Name); o != nil {
+			obj = o
+		} else if _, o := p.scope.LookupParent(expr.FuncName.Name); o != nil {
+			obj = o
+		} else {
+			logger.Panicf("func %s undefined", expr.FuncName.Name)
+		}
+		fnType, _ := obj.Type.(*types.Func)
+
+		var args []ir.Value
+		for i, a := range expr.Args {
+			v, vt := p.compileExpr(a)
+			if fnType != nil && i < len(fnType.Params) {
+				v = p.convert(v, vt, fnType.Params[i])
+			}
+			args = append(args, v)
+		}
+
+		calleeName := obj.LLName
+		if obj.Builtin {
+			calleeName = fmt.Sprintf("@ugo_builtin_%s", expr.FuncName.Name)
+		}
+
+		retLLVM := "i32"
+		if fnType != nil {
+			retLLVM = fnType.LLVM()
+		}
+		val = p.b.CreateCall(calleeName, retLLVM, args)
+		if fnType != nil && len(fnType.Results) > 0 {
+			return val, fnType.Results[0]
+		}
+		return val, types.TypInt32
+
 	default:
 		logger.Panicf("unknown: %[1]T, %[1]v", expr)
 	}
@@ -213,8 +498,86 @@ func (p *Compiler) compileExpr(w io.Writer, expr ast.Expr) (localName string) {
 	panic("unreachable")
 }
 
-func (p *Compiler) genId() string {
-	id := fmt.Sprintf("%%t%d", p.nextId)
-	p.nextId++
-	return id
+// convert inserts the sext/zext/fptosi/sitofp the language spec
+// requires to turn a from-typed value into a to-typed one. It is a
+// no-op once real type inference makes from == to the common case.
+func (p *Compiler) convert(val ir.Value, from, to types.Type) ir.Value {
+	if from == nil || to == nil || from.LLVM() == to.LLVM() {
+		return val
+	}
+	fb, fOk := from.(*types.Basic)
+	tb, tOk := to.(*types.Basic)
+	if !fOk || !tOk {
+		return val
+	}
+	switch {
+	case fb.IsFloat() && !tb.IsFloat():
+		return p.b.CreateFPToSI(val, tb.LLVM())
+	case !fb.IsFloat() && tb.IsFloat():
+		return p.b.CreateSIToFP(val, tb.LLVM())
+	case tb.IsUnsigned():
+		return p.b.CreateZExt(val, tb.LLVM())
+	default:
+		return p.b.CreateSExt(val, tb.LLVM())
+	}
+}
+
+func isFloat(t types.Type) bool {
+	b, ok := t.(*types.Basic)
+	return ok && b.IsFloat()
+}
+
+func isUnsigned(t types.Type) bool {
+	b, ok := t.(*types.Basic)
+	return ok && b.IsUnsigned()
+}
+
+func icmpPred(op token.Token, unsigned bool) string {
+	switch op {
+	case token.EQL:
+		return "eq"
+	case token.NEQ:
+		return "ne"
+	case token.LSS:
+		if unsigned {
+			return "ult"
+		}
+		return "slt"
+	case token.LEQ:
+		if unsigned {
+			return "ule"
+		}
+		return "sle"
+	case token.GTR:
+		if unsigned {
+			return "ugt"
+		}
+		return "sgt"
+	case token.GEQ:
+		if unsigned {
+			return "uge"
+		}
+		return "sge"
+	}
+	logger.Panicf("unknown comparison: %v", op)
+	panic("unreachable")
+}
+
+func fcmpPred(op token.Token) string {
+	switch op {
+	case token.EQL:
+		return "oeq"
+	case token.NEQ:
+		return "one"
+	case token.LSS:
+		return "olt"
+	case token.LEQ:
+		return "ole"
+	case token.GTR:
+		return "ogt"
+	case token.GEQ:
+		return "oge"
+	}
+	logger.Panicf("unknown comparison: %v", op)
+	panic("unreachable")
 }
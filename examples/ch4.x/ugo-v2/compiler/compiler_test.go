@@ -0,0 +1,73 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/chai2010/ugo/ast"
+	"github.com/chai2010/ugo/ir"
+	"github.com/chai2010/ugo/token"
+)
+
+// TestIfWithReturnSingleTerminator builds:
+//
+//	func f(x int32) int32 {
+//	    if x > 0 {
+//	        return x
+//	    }
+//	    return 0
+//	}
+//
+// and checks that every basic block ends with exactly one terminator.
+// A single compiler-wide "have we returned" flag gets this wrong in
+// both directions: the if.then block (which already returned) would
+// get a second, stray br, while the if.end block (reached only from
+// the implicit else edge) would lose its own return because the flag
+// was already set to true by the then-branch.
+func TestIfWithReturnSingleTerminator(t *testing.T) {
+	xIdent := &ast.Ident{Name: "x"}
+	fn := &ast.Func{
+		Name:    "f",
+		Params:  []*ast.Field{{Name: xIdent}},
+		Results: []*ast.Field{{Name: &ast.Ident{Name: "_"}}},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.IfStmt{
+				Cond: &ast.BinaryExpr{X: xIdent, Y: &ast.Number{Value: 0}, Op: token.GTR},
+				Body: &ast.BlockStmt{List: []ast.Stmt{
+					&ast.ReturnStmt{Results: []ast.Expr{xIdent}},
+				}},
+			},
+			&ast.ReturnStmt{Results: []ast.Expr{&ast.Number{Value: 0}}},
+		}},
+	}
+	file := &ast.File{Pkg: &ast.PkgSpec{Name: "main"}, Funcs: []*ast.Func{fn}}
+
+	m := (&Compiler{}).Compile(file)
+
+	irFn := m.Funcs[0]
+	for _, blk := range irFn.Blocks {
+		if !blk.Terminated {
+			t.Errorf("block %q: no terminator emitted", blk.Label)
+			continue
+		}
+		if len(blk.Instr) == 0 {
+			t.Errorf("block %q: terminated but has no instructions", blk.Label)
+			continue
+		}
+		if !isTerminator(blk.Instr[len(blk.Instr)-1]) {
+			t.Errorf("block %q: last instruction is %q, not a terminator", blk.Label, blk.Instr[len(blk.Instr)-1].Op)
+		}
+		for _, instr := range blk.Instr[:len(blk.Instr)-1] {
+			if isTerminator(instr) {
+				t.Errorf("block %q: terminator %q found before the end of the block", blk.Label, instr.Op)
+			}
+		}
+	}
+}
+
+func isTerminator(instr *ir.Instruction) bool {
+	switch instr.Op {
+	case "br", "condbr", "ret":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/chai2010/ugo/ast"
+	"github.com/chai2010/ugo/types"
+)
+
+// Object is a named entity visible in some Scope: a global, a local
+// var, a param, or a func.
+type Object struct {
+	Name    string
+	LLName  string
+	Node    ast.Node
+	Type    types.Type
+	Builtin bool
+}
+
+// Scope maps names to Objects, chained to an Outer scope for lexical
+// lookup. The Compiler pushes a new Scope for each function and block.
+type Scope struct {
+	Outer *Scope
+	table map[string]*Object
+}
+
+func NewScope(outer *Scope) *Scope {
+	return &Scope{Outer: outer, table: make(map[string]*Object)}
+}
+
+func (s *Scope) Insert(obj *Object) {
+	s.table[obj.Name] = obj
+}
+
+// Lookup only looks in s itself.
+func (s *Scope) Lookup(name string) *Object {
+	return s.table[name]
+}
+
+// LookupParent searches outer scopes, returning the Scope the Object
+// was found in along with the Object itself.
+func (s *Scope) LookupParent(name string) (*Scope, *Object) {
+	for scope := s.Outer; scope != nil; scope = scope.Outer {
+		if obj, ok := scope.table[name]; ok {
+			return scope, obj
+		}
+	}
+	return nil, nil
+}
+
+// Universe is the outermost scope, pre-populated with the builtin
+// functions every uGo package can call without importing anything.
+var Universe = NewScope(nil)
+
+func init() {
+	for _, name := range []string{"exit", "print", "println"} {
+		Universe.Insert(&Object{
+			Name:    name,
+			LLName:  fmt.Sprintf("@ugo_builtin_%s", name),
+			Type:    types.NewFunc([]types.Type{types.TypInt32}, []types.Type{types.TypInt32}),
+			Builtin: true,
+		})
+	}
+}
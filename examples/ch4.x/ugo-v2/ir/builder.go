@@ -0,0 +1,210 @@
+package ir
+
+import "fmt"
+
+// Builder appends instructions to the current basic block of the
+// current function of a Module, handing back typed Values so callers
+// never have to splice LLVM syntax together themselves.
+type Builder struct {
+	M *Module
+
+	curFunc  *Function
+	curBlock *BasicBlock
+
+	nextValueId int
+	nextLabelId int
+}
+
+func NewBuilder(m *Module) *Builder {
+	return &Builder{M: m}
+}
+
+// SetFunc makes fn the current function; new blocks are appended to it.
+func (b *Builder) SetFunc(fn *Function) {
+	b.curFunc = fn
+	b.curBlock = nil
+}
+
+// NewBlock creates a basic block with the given label, appends it to the
+// current function and makes it the insertion point.
+func (b *Builder) NewBlock(label string) *BasicBlock {
+	blk := &BasicBlock{Label: label}
+	b.curFunc.Blocks = append(b.curFunc.Blocks, blk)
+	b.curBlock = blk
+	return blk
+}
+
+// SetBlock switches the insertion point to an existing block, e.g. to
+// resume emitting into a block created earlier for a forward branch.
+func (b *Builder) SetBlock(blk *BasicBlock) {
+	b.curBlock = blk
+}
+
+// CurrentBlockLabel returns the label of the block currently being
+// filled in, e.g. so a phi node can record it as a predecessor.
+func (b *Builder) CurrentBlockLabel() string {
+	return b.curBlock.Label
+}
+
+// BlockTerminated reports whether the block currently being filled in
+// already ended with a br/condbr/ret. Callers that unconditionally
+// want to close a block with a branch (the if/for/return lowering in
+// package compiler) must check this first: a block can only have one
+// terminator, and a body that already returned has already supplied
+// one.
+func (b *Builder) BlockTerminated() bool {
+	return b.curBlock.Terminated
+}
+
+// NewLabel returns a fresh, unique block label built from prefix.
+func (b *Builder) NewLabel(prefix string) string {
+	id := b.nextLabelId
+	b.nextLabelId++
+	return fmt.Sprintf("%s.%d", prefix, id)
+}
+
+func (b *Builder) newValueName() string {
+	name := fmt.Sprintf("%%t%d", b.nextValueId)
+	b.nextValueId++
+	return name
+}
+
+func (b *Builder) emit(ins *Instruction) {
+	b.curBlock.Instr = append(b.curBlock.Instr, ins)
+}
+
+func (b *Builder) binOp(op string, x, y Value) Value {
+	result := Value{Name: b.newValueName(), Type: x.Type}
+	b.emit(&Instruction{Op: op, Result: result, Operands: []Value{x, y}})
+	return result
+}
+
+func (b *Builder) CreateAdd(x, y Value) Value  { return b.binOp("add", x, y) }
+func (b *Builder) CreateSub(x, y Value) Value  { return b.binOp("sub", x, y) }
+func (b *Builder) CreateMul(x, y Value) Value  { return b.binOp("mul", x, y) }
+func (b *Builder) CreateSDiv(x, y Value) Value { return b.binOp("sdiv", x, y) }
+func (b *Builder) CreateUDiv(x, y Value) Value { return b.binOp("udiv", x, y) }
+func (b *Builder) CreateFAdd(x, y Value) Value { return b.binOp("fadd", x, y) }
+func (b *Builder) CreateFSub(x, y Value) Value { return b.binOp("fsub", x, y) }
+func (b *Builder) CreateFMul(x, y Value) Value { return b.binOp("fmul", x, y) }
+func (b *Builder) CreateFDiv(x, y Value) Value { return b.binOp("fdiv", x, y) }
+
+// CreateICmp compares x and y using the given LLVM icmp predicate (eq,
+// ne, slt, sle, sgt, sge, ult, ule, ugt, uge), producing an i1 value.
+func (b *Builder) CreateICmp(pred string, x, y Value) Value {
+	result := Value{Name: b.newValueName(), Type: "i1"}
+	b.emit(&Instruction{Op: "icmp", Pred: pred, Result: result, Operands: []Value{x, y}})
+	return result
+}
+
+// CreateICmpNE compares x and y for inequality, producing an i1 value
+// suitable for a CreateCondBr condition.
+func (b *Builder) CreateICmpNE(x, y Value) Value {
+	return b.CreateICmp("ne", x, y)
+}
+
+// CreateFCmp compares x and y using the given LLVM fcmp predicate
+// (oeq, one, olt, ole, ogt, oge), producing an i1 value.
+func (b *Builder) CreateFCmp(pred string, x, y Value) Value {
+	result := Value{Name: b.newValueName(), Type: "i1"}
+	b.emit(&Instruction{Op: "fcmp", Pred: pred, Result: result, Operands: []Value{x, y}})
+	return result
+}
+
+func (b *Builder) convert(op string, val Value, toType string) Value {
+	result := Value{Name: b.newValueName(), Type: toType}
+	b.emit(&Instruction{Op: op, Result: result, Operands: []Value{val}})
+	return result
+}
+
+// CreateSExt sign-extends val to toType (e.g. "i32" -> "i64").
+func (b *Builder) CreateSExt(val Value, toType string) Value { return b.convert("sext", val, toType) }
+
+// CreateZExt zero-extends val to toType.
+func (b *Builder) CreateZExt(val Value, toType string) Value { return b.convert("zext", val, toType) }
+
+// CreateFPToSI converts a floating-point val to the signed integer
+// type toType.
+func (b *Builder) CreateFPToSI(val Value, toType string) Value {
+	return b.convert("fptosi", val, toType)
+}
+
+// CreateSIToFP converts a signed integer val to the floating-point
+// type toType.
+func (b *Builder) CreateSIToFP(val Value, toType string) Value {
+	return b.convert("sitofp", val, toType)
+}
+
+// CreateAlloca reserves stack space for typ and binds it to llName (the
+// compiler picks the name so that scope lookups can find it again).
+func (b *Builder) CreateAlloca(llName, typ string) Value {
+	result := Value{Name: llName, Type: typ + "*"}
+	b.emit(&Instruction{Op: "alloca", Result: result, AllocType: typ})
+	return result
+}
+
+func (b *Builder) CreateLoad(ptr Value) Value {
+	result := Value{Name: b.newValueName(), Type: elemType(ptr.Type)}
+	b.emit(&Instruction{Op: "load", Result: result, Operands: []Value{ptr}})
+	return result
+}
+
+func (b *Builder) CreateStore(val, ptr Value) {
+	b.emit(&Instruction{Op: "store", Operands: []Value{val, ptr}})
+}
+
+// CreateCall invokes fnName with args, returning the result value when
+// retType is non-empty, or the zero Value for a "void" call.
+func (b *Builder) CreateCall(fnName, retType string, args []Value) Value {
+	var result Value
+	if retType != "" && retType != "void" {
+		result = Value{Name: b.newValueName(), Type: retType}
+	}
+	b.emit(&Instruction{Op: "call", Callee: fnName, Result: result, Operands: args})
+	return result
+}
+
+func (b *Builder) CreateBr(label string) {
+	b.emit(&Instruction{Op: "br", Labels: []string{label}})
+	b.curBlock.Terminated = true
+}
+
+func (b *Builder) CreateCondBr(cond Value, thenLabel, elseLabel string) {
+	b.emit(&Instruction{Op: "condbr", Operands: []Value{cond}, Labels: []string{thenLabel, elseLabel}})
+	b.curBlock.Terminated = true
+}
+
+// CreateRet emits a terminator; pass the zero Value for "ret void".
+func (b *Builder) CreateRet(val Value) {
+	ins := &Instruction{Op: "ret"}
+	if val.Type != "" {
+		ins.Operands = []Value{val}
+	}
+	b.emit(ins)
+	b.curBlock.Terminated = true
+}
+
+// PHIIncoming is one (value, predecessor label) pair of a phi node.
+type PHIIncoming struct {
+	Value Value
+	Label string
+}
+
+func (b *Builder) CreatePHI(typ string, incoming []PHIIncoming) Value {
+	result := Value{Name: b.newValueName(), Type: typ}
+	ins := &Instruction{Op: "phi", Result: result}
+	for _, in := range incoming {
+		ins.Operands = append(ins.Operands, in.Value)
+		ins.Labels = append(ins.Labels, in.Label)
+	}
+	b.emit(ins)
+	return result
+}
+
+// elemType strips one trailing '*' from a pointer type, e.g. "i32*" -> "i32".
+func elemType(ptrType string) string {
+	if n := len(ptrType); n > 0 && ptrType[n-1] == '*' {
+		return ptrType[:n-1]
+	}
+	return ptrType
+}
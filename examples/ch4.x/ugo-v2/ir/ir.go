@@ -0,0 +1,164 @@
+// Package ir defines an in-memory representation of LLVM IR.
+//
+// The compiler builds a *Module* through a *Builder* instead of writing
+// LLVM syntax straight to an io.Writer. Keeping each Instruction's
+// opcode and operands as structured fields, rather than pre-rendered
+// text, means a pass can walk or rewrite them (constant-fold an
+// Operand, retarget a phi's Labels, drop a dead Result, ...) before
+// Instruction.String ever turns them into text.
+package ir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Value is anything that can appear as an operand: a constant, an SSA
+// register such as "%t3", a global such as "@ugo_pkg_g", or a basic
+// block argument. Type is the LLVM type spelling, e.g. "i32" or "i32*".
+type Value struct {
+	Name string
+	Type string
+}
+
+// Global is a package-level variable.
+type Global struct {
+	LLName string
+	Type   string
+}
+
+// Param is a single function parameter.
+type Param struct {
+	LLName string
+	Type   string
+}
+
+// Instruction is a single LLVM instruction kept as structured fields
+// rather than pre-rendered text, so a pass can actually inspect or
+// rewrite its opcode and operands (constant-fold Operands, retarget a
+// phi's Labels, drop an Instruction whose Result is unused, ...)
+// instead of pattern-matching strings. String() does the one-time
+// rendering to LLVM syntax that WriteLLVM needs.
+type Instruction struct {
+	// Op is the LLVM opcode: "add", "sdiv", "load", "store", "alloca",
+	// "call", "br", "condbr" (unconditional/conditional branch are
+	// distinguished here, both render to LLVM's "br"), "ret", "phi",
+	// "icmp", "fcmp", "sext", "zext", "fptosi", "sitofp".
+	Op string
+	// Result is the SSA value this instruction defines; Result.Name is
+	// "" for instructions that don't produce one (store, br, condbr,
+	// ret void).
+	Result Value
+	// Operands are the instruction's value operands, in emission
+	// order (e.g. [cond] for condbr, [val, ptr] for store).
+	Operands []Value
+	// Pred is the icmp/fcmp predicate ("eq", "ne", "slt", "oeq", ...);
+	// "" for every other Op.
+	Pred string
+	// Callee is the call target; "" for every other Op.
+	Callee string
+	// Labels are branch targets (br: 1, condbr: [then, else]) or, for
+	// phi, the predecessor block paired by index with Operands.
+	Labels []string
+	// AllocType is alloca's allocated type; Result.Type is the
+	// resulting pointer type.
+	AllocType string
+}
+
+// String renders the instruction to LLVM textual syntax.
+func (ins *Instruction) String() string {
+	switch ins.Op {
+	case "alloca":
+		return fmt.Sprintf("%s = alloca %s, align 4", ins.Result.Name, ins.AllocType)
+	case "load":
+		ptr := ins.Operands[0]
+		return fmt.Sprintf("%s = load %s, %s %s, align 4", ins.Result.Name, ins.Result.Type, ptr.Type, ptr.Name)
+	case "store":
+		val, ptr := ins.Operands[0], ins.Operands[1]
+		return fmt.Sprintf("store %s %s, %s %s", val.Type, val.Name, ptr.Type, ptr.Name)
+	case "call":
+		argTypes := make([]string, len(ins.Operands))
+		argVals := make([]string, len(ins.Operands))
+		for i, arg := range ins.Operands {
+			argTypes[i] = arg.Type
+			argVals[i] = arg.Type + " " + arg.Name
+		}
+		if ins.Result.Name == "" {
+			return fmt.Sprintf("call void(%s) %s(%s)", strings.Join(argTypes, ", "), ins.Callee, strings.Join(argVals, ", "))
+		}
+		return fmt.Sprintf("%s = call %s(%s) %s(%s)", ins.Result.Name, ins.Result.Type, strings.Join(argTypes, ", "), ins.Callee, strings.Join(argVals, ", "))
+	case "br":
+		return fmt.Sprintf("br label %%%s", ins.Labels[0])
+	case "condbr":
+		cond := ins.Operands[0]
+		return fmt.Sprintf("br i1 %s, label %%%s, label %%%s", cond.Name, ins.Labels[0], ins.Labels[1])
+	case "ret":
+		if len(ins.Operands) == 0 {
+			return "ret void"
+		}
+		val := ins.Operands[0]
+		return fmt.Sprintf("ret %s %s", val.Type, val.Name)
+	case "phi":
+		entries := make([]string, len(ins.Operands))
+		for i, val := range ins.Operands {
+			entries[i] = fmt.Sprintf("[ %s, %%%s ]", val.Name, ins.Labels[i])
+		}
+		return fmt.Sprintf("%s = phi %s %s", ins.Result.Name, ins.Result.Type, strings.Join(entries, ", "))
+	case "icmp":
+		x, y := ins.Operands[0], ins.Operands[1]
+		return fmt.Sprintf("%s = icmp %s %s %s, %s", ins.Result.Name, ins.Pred, x.Type, x.Name, y.Name)
+	case "fcmp":
+		x, y := ins.Operands[0], ins.Operands[1]
+		return fmt.Sprintf("%s = fcmp %s %s %s, %s", ins.Result.Name, ins.Pred, x.Type, x.Name, y.Name)
+	case "sext", "zext", "fptosi", "sitofp":
+		val := ins.Operands[0]
+		return fmt.Sprintf("%s = %s %s %s to %s", ins.Result.Name, ins.Op, val.Type, val.Name, ins.Result.Type)
+	default:
+		x, y := ins.Operands[0], ins.Operands[1]
+		return fmt.Sprintf("%s = %s %s %s, %s", ins.Result.Name, ins.Op, x.Type, x.Name, y.Name)
+	}
+}
+
+// BasicBlock is a straight-line sequence of instructions ending in a
+// terminator (br/ret). Terminated records whether that terminator has
+// already been emitted, so callers building control flow on top of a
+// Builder (if/for/return) know not to append a second one.
+type BasicBlock struct {
+	Label      string
+	Instr      []*Instruction
+	Terminated bool
+}
+
+// Function is either a definition (Blocks != nil) or a declaration.
+type Function struct {
+	LLName     string
+	Params     []Param
+	ResultType string
+	Blocks     []*BasicBlock
+}
+
+// Module is a whole compilation unit: the package's globals and funcs,
+// plus the raw text the frontend wants placed immediately before
+// (Header) and after (Trailer) them, e.g. a package comment, builtin
+// runtime declarations, or a generated main wrapper. Keeping those as
+// part of the Module means any backend that consumes a Module, not
+// just WriteLLVM, sees the whole compilation unit.
+type Module struct {
+	PkgName string
+	Header  string
+	Trailer string
+	Globals []*Global
+	Funcs   []*Function
+}
+
+func NewModule(pkgName string) *Module {
+	return &Module{PkgName: pkgName}
+}
+
+func (m *Module) AddGlobal(g *Global) {
+	m.Globals = append(m.Globals, g)
+}
+
+func (m *Module) AddFunc(fn *Function) {
+	m.Funcs = append(m.Funcs, fn)
+}
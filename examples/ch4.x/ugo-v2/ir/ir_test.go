@@ -0,0 +1,40 @@
+package ir
+
+import "testing"
+
+// TestInstructionStringCall guards the "call" case's operand rendering:
+// every argument needs its LLVM type as well as its value, or llc
+// rejects the instruction with "expected value token".
+func TestInstructionStringCall(t *testing.T) {
+	tests := []struct {
+		name string
+		ins  *Instruction
+		want string
+	}{
+		{
+			name: "single arg",
+			ins: &Instruction{
+				Op:       "call",
+				Callee:   "@ugo_builtin_exit",
+				Operands: []Value{{Name: "%t22", Type: "i32"}},
+			},
+			want: "call void(i32) @ugo_builtin_exit(i32 %t22)",
+		},
+		{
+			name: "multi arg with result",
+			ins: &Instruction{
+				Op:       "call",
+				Callee:   "@ugo_main_add",
+				Result:   Value{Name: "%t23", Type: "i32"},
+				Operands: []Value{{Name: "%t20", Type: "i32"}, {Name: "%t21", Type: "i32"}},
+			},
+			want: "%t23 = call i32(i32, i32) @ugo_main_add(i32 %t20, i32 %t21)",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.ins.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
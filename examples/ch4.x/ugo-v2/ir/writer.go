@@ -0,0 +1,60 @@
+package ir
+
+import (
+	"fmt"
+	"io"
+)
+
+// WriteLLVM serializes m as textual LLVM IR. This is the only place
+// that knows how a Module turns into bytes, so alternative backends
+// (see the backend package) can consume the same Module without
+// reimplementing the frontend.
+func WriteLLVM(w io.Writer, m *Module) {
+	if m.Header != "" {
+		fmt.Fprintln(w, m.Header)
+	}
+
+	for _, g := range m.Globals {
+		fmt.Fprintf(w, "%s = global %s zeroinitializer\n", g.LLName, g.Type)
+	}
+	if len(m.Globals) != 0 {
+		fmt.Fprintln(w)
+	}
+
+	for _, fn := range m.Funcs {
+		writeFunc(w, fn)
+	}
+
+	if m.Trailer != "" {
+		fmt.Fprintln(w, m.Trailer)
+	}
+}
+
+func writeFunc(w io.Writer, fn *Function) {
+	params := ""
+	for i, p := range fn.Params {
+		if i > 0 {
+			params += ", "
+		}
+		params += p.Type
+		if p.LLName != "" {
+			params += " " + p.LLName
+		}
+	}
+
+	if fn.Blocks == nil {
+		fmt.Fprintf(w, "declare %s %s(%s)\n", fn.ResultType, fn.LLName, params)
+		return
+	}
+
+	fmt.Fprintf(w, "define %s %s(%s) {\n", fn.ResultType, fn.LLName, params)
+	for _, blk := range fn.Blocks {
+		if blk.Label != "" {
+			fmt.Fprintf(w, "%s:\n", blk.Label)
+		}
+		for _, instr := range blk.Instr {
+			fmt.Fprintf(w, "\t%s\n", instr.String())
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
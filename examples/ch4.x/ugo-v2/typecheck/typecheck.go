@@ -0,0 +1,200 @@
+// Package typecheck runs between parsing and compiler.Compile. It
+// assigns every expression and every declared var/param a types.Type so
+// that codegen can pick the right LLVM instruction instead of assuming
+// i32 everywhere.
+package typecheck
+
+import (
+	"github.com/chai2010/ugo/ast"
+	"github.com/chai2010/ugo/logger"
+	"github.com/chai2010/ugo/token"
+	"github.com/chai2010/ugo/types"
+)
+
+// Info is the result of Check: the type computed for every expression
+// and every declaration (*ast.VarSpec, *ast.Field, *ast.Func) in the file.
+type Info struct {
+	Types   map[ast.Expr]types.Type
+	Objects map[ast.Node]types.Type
+}
+
+func newInfo() *Info {
+	return &Info{
+		Types:   make(map[ast.Expr]types.Type),
+		Objects: make(map[ast.Node]types.Type),
+	}
+}
+
+// scope is typecheck's own, throwaway symbol table; it only needs to
+// answer "what type is this name", not carry LLVM names around like
+// compiler.Scope does.
+type scope struct {
+	outer *scope
+	vars  map[string]types.Type
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, vars: make(map[string]types.Type)}
+}
+
+func (s *scope) insert(name string, t types.Type) {
+	s.vars[name] = t
+}
+
+func (s *scope) lookup(name string) types.Type {
+	for sc := s; sc != nil; sc = sc.outer {
+		if t, ok := sc.vars[name]; ok {
+			return t
+		}
+	}
+	return nil
+}
+
+type checker struct {
+	info  *Info
+	scope *scope
+}
+
+// Check type-checks file and returns the annotations Compile needs.
+// uGo has no type syntax yet, so every var/param defaults to int32;
+// the one real inference is that comparisons and &&/|| produce bool,
+// which is what makes typed control flow (see compiler.compileCond)
+// possible.
+func Check(file *ast.File) *Info {
+	c := &checker{info: newInfo(), scope: newScope(nil)}
+
+	for _, g := range file.Globals {
+		c.scope.insert(g.Name.Name, types.TypInt32)
+		c.info.Objects[g] = types.TypInt32
+	}
+	for _, fn := range file.Funcs {
+		var params, results []types.Type
+		for range fn.Params {
+			params = append(params, types.TypInt32)
+		}
+		for range fn.Results {
+			results = append(results, types.TypInt32)
+		}
+		ft := types.NewFunc(params, results)
+		c.scope.insert(fn.Name, ft)
+		c.info.Objects[fn] = ft
+	}
+	for _, fn := range file.Funcs {
+		if fn.Body != nil {
+			c.checkFunc(fn)
+		}
+	}
+
+	return c.info
+}
+
+func (c *checker) checkFunc(fn *ast.Func) {
+	c.scope = newScope(c.scope)
+	defer func() { c.scope = c.scope.outer }()
+
+	for _, param := range fn.Params {
+		c.scope.insert(param.Name.Name, types.TypInt32)
+		c.info.Objects[param] = types.TypInt32
+	}
+	c.checkStmt(fn.Body)
+}
+
+func (c *checker) checkStmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.VarSpec:
+		t := types.Type(types.TypInt32)
+		if stmt.Value != nil {
+			t = c.checkExpr(stmt.Value)
+		}
+		c.scope.insert(stmt.Name.Name, t)
+		c.info.Objects[stmt] = t
+
+	case *ast.AssignStmt:
+		c.checkExpr(stmt.Value)
+
+	case *ast.BlockStmt:
+		c.scope = newScope(c.scope)
+		for _, x := range stmt.List {
+			c.checkStmt(x)
+		}
+		c.scope = c.scope.outer
+
+	case *ast.ExprStmt:
+		c.checkExpr(stmt.X)
+
+	case *ast.IfStmt:
+		c.checkExpr(stmt.Cond)
+		c.checkStmt(stmt.Body)
+		if stmt.Else != nil {
+			c.checkStmt(stmt.Else)
+		}
+
+	case *ast.ForStmt:
+		c.scope = newScope(c.scope)
+		if stmt.Init != nil {
+			c.checkStmt(stmt.Init)
+		}
+		if stmt.Cond != nil {
+			c.checkExpr(stmt.Cond)
+		}
+		if stmt.Post != nil {
+			c.checkStmt(stmt.Post)
+		}
+		c.checkStmt(stmt.Body)
+		c.scope = c.scope.outer
+
+	case *ast.ReturnStmt:
+		for _, r := range stmt.Results {
+			c.checkExpr(r)
+		}
+
+	default:
+		logger.Panicf("unknown: %[1]T, %[1]v", stmt)
+	}
+}
+
+func (c *checker) checkExpr(expr ast.Expr) types.Type {
+	var t types.Type
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		t = c.scope.lookup(expr.Name)
+		if t == nil {
+			logger.Panicf("var %s undefined", expr.Name)
+		}
+
+	case *ast.Number:
+		t = types.TypInt32
+
+	case *ast.BinaryExpr:
+		x := c.checkExpr(expr.X)
+		c.checkExpr(expr.Y)
+		switch expr.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ, token.LAND, token.LOR:
+			t = types.TypBool
+		default:
+			t = x
+		}
+
+	case *ast.UnaryExpr:
+		t = c.checkExpr(expr.X)
+
+	case *ast.ParenExpr:
+		t = c.checkExpr(expr.X)
+
+	case *ast.CallExpr:
+		for _, a := range expr.Args {
+			c.checkExpr(a)
+		}
+		if fn, ok := c.scope.lookup(expr.FuncName.Name).(*types.Func); ok && len(fn.Results) > 0 {
+			t = fn.Results[0]
+		} else {
+			t = types.TypInt32
+		}
+
+	default:
+		logger.Panicf("unknown: %[1]T, %[1]v", expr)
+	}
+
+	c.info.Types[expr] = t
+	return t
+}
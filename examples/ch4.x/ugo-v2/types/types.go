@@ -0,0 +1,126 @@
+// Package types models the value types the compiler reasons about, so
+// that code generation can stop assuming every value is an i32 and
+// instead pick the right LLVM instruction (add vs fadd, sdiv vs udiv vs
+// fdiv, icmp vs fcmp, ...) for the operands it is actually given.
+package types
+
+// Type is implemented by every type the language can express.
+type Type interface {
+	// String is the language-level spelling, e.g. "int32" or "*int32".
+	String() string
+	// LLVM is the corresponding LLVM type, e.g. "i32" or "i32*".
+	LLVM() string
+}
+
+type BasicKind int
+
+const (
+	Invalid BasicKind = iota
+	Bool
+	Int8
+	Int16
+	Int32
+	Int64
+	Uint8
+	Uint16
+	Uint32
+	Uint64
+	Float32
+	Float64
+)
+
+// Basic is a predeclared scalar type such as bool, int32 or float64.
+type Basic struct {
+	kind BasicKind
+	name string
+	llvm string
+}
+
+func (b *Basic) Kind() BasicKind { return b.kind }
+func (b *Basic) String() string  { return b.name }
+func (b *Basic) LLVM() string    { return b.llvm }
+
+func (b *Basic) IsInteger() bool {
+	switch b.kind {
+	case Int8, Int16, Int32, Int64, Uint8, Uint16, Uint32, Uint64:
+		return true
+	}
+	return false
+}
+
+func (b *Basic) IsUnsigned() bool {
+	switch b.kind {
+	case Uint8, Uint16, Uint32, Uint64:
+		return true
+	}
+	return false
+}
+
+func (b *Basic) IsFloat() bool {
+	return b.kind == Float32 || b.kind == Float64
+}
+
+// Predeclared basic types.
+var (
+	TypBool    = &Basic{Bool, "bool", "i1"}
+	TypInt8    = &Basic{Int8, "int8", "i8"}
+	TypInt16   = &Basic{Int16, "int16", "i16"}
+	TypInt32   = &Basic{Int32, "int32", "i32"}
+	TypInt64   = &Basic{Int64, "int64", "i64"}
+	TypUint8   = &Basic{Uint8, "uint8", "i8"}
+	TypUint16  = &Basic{Uint16, "uint16", "i16"}
+	TypUint32  = &Basic{Uint32, "uint32", "i32"}
+	TypUint64  = &Basic{Uint64, "uint64", "i64"}
+	TypFloat32 = &Basic{Float32, "float32", "float"}
+	TypFloat64 = &Basic{Float64, "float64", "double"}
+)
+
+// Pointer is a pointer to another type.
+type Pointer struct {
+	Elem Type
+}
+
+func NewPointer(elem Type) *Pointer { return &Pointer{Elem: elem} }
+
+func (p *Pointer) String() string { return "*" + p.Elem.String() }
+func (p *Pointer) LLVM() string   { return p.Elem.LLVM() + "*" }
+
+// Func is the signature of a function: its parameter and result types.
+type Func struct {
+	Params  []Type
+	Results []Type
+}
+
+func NewFunc(params, results []Type) *Func {
+	return &Func{Params: params, Results: results}
+}
+
+func (f *Func) String() string {
+	s := "func("
+	for i, p := range f.Params {
+		if i > 0 {
+			s += ", "
+		}
+		s += p.String()
+	}
+	s += ")"
+	for i, r := range f.Results {
+		if i > 0 {
+			s += ", "
+		} else {
+			s += " "
+		}
+		s += r.String()
+	}
+	return s
+}
+
+// LLVM is the return type of the function as LLVM sees it: the first
+// result, or "void" for a function with none. uGo does not yet support
+// multiple return values.
+func (f *Func) LLVM() string {
+	if len(f.Results) == 0 {
+		return "void"
+	}
+	return f.Results[0].LLVM()
+}